@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kaleworsley/tracklog/pkg/db"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// APITokenAuth authenticates requests bearing an
+// "Authorization: Bearer <token>" header issued via the account tokens
+// page.
+type APITokenAuth struct {
+	DB db.DB
+}
+
+// Authenticate implements Authenticator.
+func (a *APITokenAuth) Authenticate(r *http.Request) (*models.User, error) {
+	apiToken, err := a.ResolveToken(r)
+	if err != nil || apiToken == nil {
+		return nil, err
+	}
+
+	if err := a.DB.TouchAPIToken(apiToken.ID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return a.DB.UserByID(apiToken.UserID)
+}
+
+// ResolveToken looks up the *models.APIToken named by r's bearer token,
+// without touching its last-used timestamp. Server keeps a reference to
+// the APITokenAuth used to build its Chain so handlers can call this
+// directly to enforce scopes, which Authenticate's return value (a
+// *models.User) can't carry.
+func (a *APITokenAuth) ResolveToken(r *http.Request) (*models.APIToken, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	return a.DB.APITokenByHash(hash[:])
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(auth, prefix)
+}
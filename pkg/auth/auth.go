@@ -0,0 +1,40 @@
+// Package auth resolves the user, if any, associated with an incoming
+// HTTP request. Each authentication mode (session cookie, reverse-proxy
+// header, OIDC, API token) is its own Authenticator; Server composes
+// them into a Chain built from config.
+package auth
+
+import (
+	"net/http"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// Authenticator resolves the user associated with r. It returns
+// (nil, nil) when r carries no credentials for this mode - that is not
+// an error, it just means the next Authenticator in a Chain should be
+// tried; credentials that fail verification, such as a session cookie
+// with a bad signature, are treated the same way. A non-nil error means
+// something unexpected went wrong (e.g. a DB failure) and should abort
+// the request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*models.User, error)
+}
+
+// Chain tries each Authenticator in order and returns the first user
+// found. If none of them find one, Chain returns (nil, nil) too.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (*models.User, error) {
+	for _, a := range c {
+		user, err := a.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// stubAuth is an Authenticator that always returns a fixed result,
+// for exercising Chain in isolation from any real authentication mode.
+type stubAuth struct {
+	user *models.User
+	err  error
+}
+
+func (s stubAuth) Authenticate(r *http.Request) (*models.User, error) {
+	return s.user, s.err
+}
+
+func TestChainReturnsFirstMatch(t *testing.T) {
+	alice := &models.User{ID: 1, Username: "alice"}
+	chain := Chain{stubAuth{}, stubAuth{user: alice}, stubAuth{user: &models.User{ID: 2, Username: "bob"}}}
+
+	user, err := chain.Authenticate(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != alice {
+		t.Errorf("expected the first matching Authenticator's user; got %v", user)
+	}
+}
+
+func TestChainNoMatch(t *testing.T) {
+	chain := Chain{stubAuth{}, stubAuth{}}
+
+	user, err := chain.Authenticate(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("expected no user; got %v", user)
+	}
+}
+
+func TestChainStopsOnError(t *testing.T) {
+	wantErr := errors.New("db exploded")
+	chain := Chain{stubAuth{err: wantErr}, stubAuth{user: &models.User{ID: 1, Username: "alice"}}}
+
+	user, err := chain.Authenticate(httptest.NewRequest("GET", "/", nil))
+	if err != wantErr {
+		t.Errorf("expected %v; got %v", wantErr, err)
+	}
+	if user != nil {
+		t.Errorf("expected no user alongside an error; got %v", user)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+
+	oidc "github.com/coreos/go-oidc"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+
+	"github.com/kaleworsley/tracklog/pkg/config"
+	"github.com/kaleworsley/tracklog/pkg/db"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// OIDCState is the information that must survive between the redirect to
+// the provider and the callback that completes it. Server is
+// responsible for storing it (in a signed cookie) between the two
+// requests.
+type OIDCState struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+}
+
+// OIDCAuth drives the OIDC/OAuth2 authorization-code flow against a
+// single configured provider. Unlike the other Authenticators, it does
+// not participate in per-request Authenticate checks: a successful OIDC
+// login ends by calling SessionAuth.SetCookie, so SessionAuth is what
+// recognises the user on subsequent requests.
+type OIDCAuth struct {
+	DB       db.DB
+	conf     config.OIDCConfig
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth2   oauth2.Config
+}
+
+// NewOIDCAuth performs provider discovery and returns an OIDCAuth ready
+// to drive sign-in. It returns (nil, nil) when OIDC is not configured.
+func NewOIDCAuth(d db.DB, conf config.OIDCConfig) (*OIDCAuth, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+
+	provider, err := oidc.NewProvider(context.Background(), conf.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCAuth{
+		DB:       d,
+		conf:     conf,
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: conf.ClientID}),
+		oauth2: oauth2.Config{
+			ClientID:     conf.ClientID,
+			ClientSecret: conf.ClientSecret,
+			RedirectURL:  conf.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       conf.Scopes,
+		},
+	}, nil
+}
+
+// Authenticate implements Authenticator. OIDC only ever identifies a user
+// as part of the explicit login/callback flow, never from an ambient
+// request, so it always returns (nil, nil).
+func (a *OIDCAuth) Authenticate(r *http.Request) (*models.User, error) {
+	return nil, nil
+}
+
+// AuthCodeURL returns the URL to redirect the browser to in order to
+// start sign-in with state. The caller must persist state until the
+// callback.
+func (a *OIDCAuth) AuthCodeURL(state OIDCState) string {
+	return a.oauth2.AuthCodeURL(state.State,
+		oauth2.S256ChallengeOption(state.CodeVerifier),
+		oidc.Nonce(state.Nonce),
+	)
+}
+
+// Callback verifies the callback request against the expected state,
+// exchanges the authorization code, verifies the ID token, and resolves
+// (or, if AutoRegister is set, creates) the corresponding user.
+func (a *OIDCAuth) Callback(r *http.Request, expected OIDCState) (*models.User, error) {
+	if r.URL.Query().Get("state") != expected.State {
+		return nil, errors.New("oidc: state mismatch")
+	}
+
+	ctx := r.Context()
+	token, err := a.oauth2.Exchange(ctx, r.URL.Query().Get("code"),
+		oauth2.SetAuthURLParam("code_verifier", expected.CodeVerifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != expected.Nonce {
+		return nil, errors.New("oidc: nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	username, _ := claims[a.conf.UsernameClaim].(string)
+	if username == "" {
+		return nil, errors.New("oidc: username claim missing from id token")
+	}
+
+	user, err := a.DB.UserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	if !a.conf.AutoRegister {
+		return nil, errors.New("oidc: no account for this user")
+	}
+
+	// Mirrors ReverseProxyAuth's auto-register path: the password is
+	// never used to sign in, so a random one is fine.
+	pwbytes := make([]byte, 128)
+	rand.Read(pwbytes)
+	pwhash, err := bcrypt.GenerateFromPassword(pwbytes, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &models.User{
+		Username: username,
+		Password: string(pwhash),
+	}
+	if err := a.DB.AddUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/rand"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kaleworsley/tracklog/pkg/db"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// ReverseProxyAuth trusts a username forwarded in a header by an
+// upstream reverse proxy that has already authenticated the request.
+type ReverseProxyAuth struct {
+	DB           db.DB
+	Header       string
+	AutoRegister bool
+}
+
+// Authenticate implements Authenticator.
+func (a *ReverseProxyAuth) Authenticate(r *http.Request) (*models.User, error) {
+	username := r.Header.Get(a.Header)
+	if username == "" {
+		return nil, nil
+	}
+
+	user, err := a.DB.UserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	if !a.AutoRegister {
+		return nil, nil
+	}
+
+	pwbytes := make([]byte, 128)
+	rand.Read(pwbytes)
+	pwhash, err := bcrypt.GenerateFromPassword(pwbytes, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &models.User{
+		Username: username,
+		Password: string(pwhash),
+	}
+	if err := a.DB.AddUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaleworsley/tracklog/pkg/db/dbtest"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+func TestReverseProxyAuthNoHeader(t *testing.T) {
+	a := &ReverseProxyAuth{DB: dbtest.New(), Header: "X-Username"}
+
+	user, err := a.Authenticate(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("expected no user without the header; got %v", user)
+	}
+}
+
+func TestReverseProxyAuthExistingUser(t *testing.T) {
+	d := dbtest.New()
+	existing := &models.User{Username: "alice"}
+	if err := d.AddUser(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &ReverseProxyAuth{DB: d, Header: "X-Username"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Username", "alice")
+
+	user, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || user.ID != existing.ID {
+		t.Errorf("expected to authenticate as the existing user %v; got %v", existing, user)
+	}
+}
+
+func TestReverseProxyAuthUnknownUserWithoutAutoRegister(t *testing.T) {
+	a := &ReverseProxyAuth{DB: dbtest.New(), Header: "X-Username"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Username", "alice")
+
+	user, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("expected no user for an unknown username with AutoRegister disabled; got %v", user)
+	}
+}
+
+func TestReverseProxyAuthAutoRegister(t *testing.T) {
+	d := dbtest.New()
+	a := &ReverseProxyAuth{DB: d, Header: "X-Username", AutoRegister: true}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Username", "alice")
+
+	user, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || user.Username != "alice" {
+		t.Fatalf("expected a newly auto-registered user named alice; got %v", user)
+	}
+
+	stored, err := d.UserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.ID != user.ID {
+		t.Errorf("expected the auto-registered user to be persisted; got %v", stored)
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+
+	"github.com/kaleworsley/tracklog/pkg/db"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+const sessionCookieName = "session"
+const sessionCookieMaxAge = 30 * 24 * time.Hour
+
+type sessionValue struct {
+	Username string
+}
+
+// SessionAuth authenticates requests carrying the signed session cookie
+// set by SetCookie after a successful password, OIDC or WebAuthn
+// sign-in.
+type SessionAuth struct {
+	DB      db.DB
+	Secure  bool
+	cookies *securecookie.SecureCookie
+}
+
+// NewSessionAuth returns a SessionAuth that signs and verifies cookies
+// with signingKey.
+func NewSessionAuth(d db.DB, signingKey string, secure bool) *SessionAuth {
+	return &SessionAuth{
+		DB:      d,
+		Secure:  secure,
+		cookies: securecookie.New([]byte(signingKey), nil),
+	}
+}
+
+// Authenticate implements Authenticator.
+func (a *SessionAuth) Authenticate(r *http.Request) (*models.User, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, nil
+	}
+
+	var v sessionValue
+	if err := a.cookies.Decode(sessionCookieName, cookie.Value, &v); err != nil {
+		return nil, nil
+	}
+
+	return a.DB.UserByUsername(v.Username)
+}
+
+// SetCookie signs user in by writing the session cookie.
+func (a *SessionAuth) SetCookie(w http.ResponseWriter, user *models.User) {
+	encoded, err := a.cookies.Encode(sessionCookieName, sessionValue{Username: user.Username})
+	if err != nil {
+		panic(err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    encoded,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   a.Secure,
+		Expires:  time.Now().Add(sessionCookieMaxAge),
+	})
+}
+
+// ClearCookie signs the current user out.
+func (a *SessionAuth) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+}
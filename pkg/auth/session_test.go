@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaleworsley/tracklog/pkg/db/dbtest"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+func TestSessionAuthRoundTrip(t *testing.T) {
+	d := dbtest.New()
+	user := &models.User{Username: "alice"}
+	if err := d.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewSessionAuth(d, "test-signing-key", false)
+
+	rec := httptest.NewRecorder()
+	a.SetCookie(rec, user)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	got, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Username != user.Username {
+		t.Errorf("expected to authenticate as %q; got %v", user.Username, got)
+	}
+}
+
+func TestSessionAuthNoCookie(t *testing.T) {
+	a := NewSessionAuth(dbtest.New(), "test-signing-key", false)
+
+	user, err := a.Authenticate(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("expected no user without a session cookie; got %v", user)
+	}
+}
+
+func TestSessionAuthTamperedCookie(t *testing.T) {
+	d := dbtest.New()
+	user := &models.User{Username: "alice"}
+	if err := d.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	signed := NewSessionAuth(d, "test-signing-key", false)
+	rec := httptest.NewRecorder()
+	signed.SetCookie(rec, user)
+
+	// A session cookie minted under a different key must not verify -
+	// otherwise an attacker who learns one signing key could forge
+	// sessions against a server running a different one.
+	differentKey := NewSessionAuth(d, "a-different-key", false)
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	got, err := differentKey.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("expected a cookie signed with a different key to fail verification; got %v", got)
+	}
+}
+
+func TestSessionAuthClearCookie(t *testing.T) {
+	a := NewSessionAuth(dbtest.New(), "test-signing-key", false)
+
+	rec := httptest.NewRecorder()
+	a.ClearCookie(rec)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected ClearCookie to set an expired cookie; got %v", cookies)
+	}
+}
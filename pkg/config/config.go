@@ -0,0 +1,69 @@
+package config
+
+import (
+	"io"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the top-level application configuration, read from a TOML
+// file at startup.
+type Config struct {
+	Server ServerConfig
+	DB     DBConfig
+}
+
+// ServerConfig holds settings for the HTTP server, including which
+// authentication modes are enabled.
+type ServerConfig struct {
+	Development       bool   `toml:"development"`
+	ListenAddress     string `toml:"listen_address"`
+	CSRFAuthKey       string `toml:"csrf_auth_key"`
+	SigningKey        string `toml:"signing_key"`
+	MapboxAccessToken string `toml:"mapbox_access_token"`
+
+	ReverseProxyAuth             bool   `toml:"reverse_proxy_auth"`
+	ReverseProxyAuthHeader       string `toml:"reverse_proxy_auth_header"`
+	ReverseProxyAuthAutoRegister bool   `toml:"reverse_proxy_auth_auto_register"`
+
+	OIDC     OIDCConfig     `toml:"oidc"`
+	WebAuthn WebAuthnConfig `toml:"webauthn"`
+}
+
+// WebAuthnConfig configures WebAuthn/passkey registration and sign-in.
+type WebAuthnConfig struct {
+	RequireForLogin bool `toml:"require_for_login"`
+}
+
+// OIDCConfig configures the optional OIDC/OAuth2 authorization-code
+// sign-in mode. It is considered enabled when IssuerURL is set.
+type OIDCConfig struct {
+	IssuerURL     string   `toml:"issuer_url"`
+	ClientID      string   `toml:"client_id"`
+	ClientSecret  string   `toml:"client_secret"`
+	RedirectURL   string   `toml:"redirect_url"`
+	Scopes        []string `toml:"scopes"`
+	UsernameClaim string   `toml:"username_claim"`
+	GroupsClaim   string   `toml:"groups_claim"`
+	AutoRegister  bool     `toml:"auto_register"`
+}
+
+// Enabled reports whether OIDC sign-in has been configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+// DBConfig holds the database driver and connection string.
+type DBConfig struct {
+	Driver string `toml:"driver"`
+	DSN    string `toml:"dsn"`
+}
+
+// Read parses a TOML configuration document from r.
+func Read(r io.Reader) (*Config, error) {
+	var c Config
+	if _, err := toml.DecodeReader(r, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
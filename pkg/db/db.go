@@ -0,0 +1,48 @@
+package db
+
+import (
+	"time"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// DB is the persistence interface used by the server package. Looking up
+// a user that does not exist returns (nil, nil), rather than an error.
+type DB interface {
+	UserByUsername(username string) (*models.User, error)
+	UserByID(id int64) (*models.User, error)
+	AddUser(user *models.User) error
+
+	AddCredential(cred *models.WebAuthnCredential) error
+	CredentialsForUser(userID int64) ([]*models.WebAuthnCredential, error)
+	CredentialByID(credentialID []byte) (*models.WebAuthnCredential, error)
+	UpdateCredentialSignCount(credentialID []byte, signCount uint32) error
+
+	CreateAPIToken(token *models.APIToken) error
+	APITokenByHash(hash []byte) (*models.APIToken, error)
+	TouchAPIToken(id int64, usedAt time.Time) error
+	RevokeAPIToken(id int64) error
+	APITokensForUser(userID int64) ([]*models.APIToken, error)
+
+	CreateLog(log *models.Log) error
+	LogsForUser(userID int64) ([]*models.Log, error)
+	LogByID(id int64) (*models.Log, error)
+	UpdateLog(log *models.Log) error
+	DeleteLog(id int64) error
+
+	// TracksVersion returns the user's current tracks_version, creating
+	// a user_state row on first use.
+	TracksVersion(userID int64) (int64, error)
+	// BumpTracksVersion increments the user's tracks_version. Call it
+	// whenever a log is uploaded, edited or deleted, so cached heatmap
+	// tiles keyed on it are invalidated.
+	BumpTracksVersion(userID int64) error
+
+	// PointsForUserInBBox streams (conceptually - a real driver should
+	// use a cursor) every point from the user's logs whose coordinates
+	// fall within the given bounding box, in no particular order - each
+	// Point's LogID and SegmentIndex identify which log/segment it came
+	// from, so callers that need per-track geometry rather than an
+	// undifferentiated heatmap can regroup them.
+	PointsForUserInBBox(userID int64, minLon, minLat, maxLon, maxLat float64) ([]models.Point, error)
+}
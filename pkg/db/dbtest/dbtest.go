@@ -0,0 +1,224 @@
+// Package dbtest is an in-memory db.DB used by other packages' tests,
+// so pkg/auth and pkg/server don't each need a real database to
+// exercise authentication and request handling.
+package dbtest
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// DB is a minimal, not-remotely-concurrent-safe-beyond-a-mutex
+// implementation of db.DB backed by maps. It exists only for tests.
+type DB struct {
+	mu sync.Mutex
+
+	nextID int64
+
+	users       map[int64]*models.User
+	credentials map[int64]*models.WebAuthnCredential
+	tokens      map[int64]*models.APIToken
+	logs        map[int64]*models.Log
+	tracksVer   map[int64]int64
+	points      map[int64][]models.Point
+}
+
+// New returns an empty DB.
+func New() *DB {
+	return &DB{
+		users:       make(map[int64]*models.User),
+		credentials: make(map[int64]*models.WebAuthnCredential),
+		tokens:      make(map[int64]*models.APIToken),
+		logs:        make(map[int64]*models.Log),
+		tracksVer:   make(map[int64]int64),
+		points:      make(map[int64][]models.Point),
+	}
+}
+
+func (db *DB) id() int64 {
+	db.nextID++
+	return db.nextID
+}
+
+func (db *DB) UserByUsername(username string) (*models.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, u := range db.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *DB) UserByID(id int64) (*models.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.users[id], nil
+}
+
+func (db *DB) AddUser(user *models.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	user.ID = db.id()
+	db.users[user.ID] = user
+	return nil
+}
+
+func (db *DB) AddCredential(cred *models.WebAuthnCredential) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	cred.ID = db.id()
+	db.credentials[cred.ID] = cred
+	return nil
+}
+
+func (db *DB) CredentialsForUser(userID int64) ([]*models.WebAuthnCredential, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var out []*models.WebAuthnCredential
+	for _, c := range db.credentials {
+		if c.UserID == userID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (db *DB) CredentialByID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, c := range db.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *DB) UpdateCredentialSignCount(credentialID []byte, signCount uint32) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, c := range db.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			c.SignCount = signCount
+			return nil
+		}
+	}
+	return nil
+}
+
+func (db *DB) CreateAPIToken(token *models.APIToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	token.ID = db.id()
+	db.tokens[token.ID] = token
+	return nil
+}
+
+func (db *DB) APITokenByHash(hash []byte) (*models.APIToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, t := range db.tokens {
+		if bytes.Equal(t.Hash, hash) {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *DB) TouchAPIToken(id int64, usedAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if t, ok := db.tokens[id]; ok {
+		t.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (db *DB) RevokeAPIToken(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.tokens, id)
+	return nil
+}
+
+func (db *DB) APITokensForUser(userID int64) ([]*models.APIToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var out []*models.APIToken
+	for _, t := range db.tokens {
+		if t.UserID == userID {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (db *DB) CreateLog(log *models.Log) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	log.ID = db.id()
+	db.logs[log.ID] = log
+	return nil
+}
+
+func (db *DB) LogsForUser(userID int64) ([]*models.Log, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var out []*models.Log
+	for _, l := range db.logs {
+		if l.UserID == userID {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (db *DB) LogByID(id int64) (*models.Log, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.logs[id], nil
+}
+
+func (db *DB) UpdateLog(log *models.Log) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.logs[log.ID] = log
+	return nil
+}
+
+func (db *DB) DeleteLog(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.logs, id)
+	return nil
+}
+
+func (db *DB) TracksVersion(userID int64) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.tracksVer[userID], nil
+}
+
+func (db *DB) BumpTracksVersion(userID int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.tracksVer[userID]++
+	return nil
+}
+
+func (db *DB) PointsForUserInBBox(userID int64, minLon, minLat, maxLon, maxLat float64) ([]models.Point, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var out []models.Point
+	for _, p := range db.points[userID] {
+		if p.Lon >= minLon && p.Lon <= maxLon && p.Lat >= minLat && p.Lat <= maxLat {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
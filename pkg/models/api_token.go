@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// APIToken is a long-lived bearer credential a user can issue for
+// scripted access to the JSON API. Only its SHA-256 hash is persisted;
+// the plaintext token is shown once, at creation time.
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Hash       []byte
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// HasScope reports whether the token grants scope, or grants no scopes
+// at all (an unscoped token, which is treated as full access).
+func (t *APIToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
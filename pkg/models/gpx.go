@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// gpxDoc is just enough of the GPX 1.1 schema to recover trackpoints,
+// including the common Garmin TrackPointExtension for heart rate and
+// cadence.
+type gpxDoc struct {
+	Tracks []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        float64   `xml:"lat,attr"`
+	Lon        float64   `xml:"lon,attr"`
+	Ele        float64   `xml:"ele"`
+	Time       time.Time `xml:"time"`
+	Extensions struct {
+		TrackPointExtension struct {
+			HR  int `xml:"hr"`
+			Cad int `xml:"cad"`
+		} `xml:"TrackPointExtension"`
+	} `xml:"extensions"`
+}
+
+func parseGPXTrack(data []byte) (*Track, error) {
+	var doc gpxDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	track := &Track{}
+	for _, t := range doc.Tracks {
+		for _, seg := range t.Segments {
+			segment := Segment{Points: make([]Point, len(seg.Points))}
+			for i, p := range seg.Points {
+				segment.Points[i] = Point{
+					Time:    p.Time,
+					Lat:     p.Lat,
+					Lon:     p.Lon,
+					Ele:     p.Ele,
+					HR:      p.Extensions.TrackPointExtension.HR,
+					Cadence: p.Extensions.TrackPointExtension.Cad,
+				}
+			}
+			track.Segments = append(track.Segments, segment)
+		}
+	}
+	return track, nil
+}
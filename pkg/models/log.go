@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Log is a single uploaded activity recording. Data holds the original
+// uploaded file verbatim; Format records what it was parsed as so it can
+// be re-parsed (or converted) on download.
+type Log struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Format     string
+	Data       []byte
+	UploadedAt time.Time
+}
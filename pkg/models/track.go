@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Track is a parsed activity recording: one or more Segments (a pause in
+// recording starts a new segment), each an ordered sequence of Points.
+type Track struct {
+	Segments []Segment
+}
+
+// Segment is a continuous run of Points with no recording gap.
+type Segment struct {
+	Points []Point
+}
+
+// Point is a single trackpoint. HR and Cadence are zero when the source
+// format didn't record them. LogID and SegmentIndex identify which log
+// and which of its segments the point came from - db.DB.PointsForUserInBBox
+// returns points across many logs and segments in no particular order,
+// and callers that need per-track geometry (rather than just a heatmap's
+// undifferentiated intensity) regroup on these fields.
+type Point struct {
+	Time         time.Time
+	Lat          float64
+	Lon          float64
+	Ele          float64
+	HR           int
+	Cadence      int
+	LogID        int64
+	SegmentIndex int
+}
+
+// ParseTrack parses a Log's raw Data according to its Format.
+//
+// Only "gpx" is implemented so far, even though the upload API also
+// accepts "tcx" and "fit" logs (see logFormatFromContentType) - those
+// are stored as-is and can be downloaded back out unchanged, but
+// anything that needs the parsed Track (GeoJSON export, heatmap tiles)
+// isn't available for them yet. Callers should surface the returned
+// error to the user rather than treating it as unexpected.
+func ParseTrack(log *Log) (*Track, error) {
+	switch log.Format {
+	case "gpx":
+		return parseGPXTrack(log.Data)
+	case "tcx":
+		return nil, fmt.Errorf("tcx logs can be downloaded but not yet parsed into a track")
+	case "fit":
+		return nil, fmt.Errorf("fit logs can be downloaded but not yet parsed into a track")
+	default:
+		return nil, fmt.Errorf("don't know how to parse a %s log into a track", log.Format)
+	}
+}
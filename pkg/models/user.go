@@ -0,0 +1,8 @@
+package models
+
+// User is an account that can sign in and upload logs.
+type User struct {
+	ID       int64
+	Username string
+	Password string
+}
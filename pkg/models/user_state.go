@@ -0,0 +1,9 @@
+package models
+
+// UserState holds small per-user counters that don't belong on User
+// itself. TracksVersion is bumped every time a user's logs change, so
+// cached heatmap tiles keyed on it are invalidated automatically.
+type UserState struct {
+	UserID        int64
+	TracksVersion int64
+}
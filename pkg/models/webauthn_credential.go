@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// WebAuthnCredential is a registered security key or platform
+// authenticator that can be used to sign in, either as a second factor
+// after a password or for fully passwordless login.
+type WebAuthnCredential struct {
+	ID           int64
+	UserID       int64
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+	AAGUID       []byte
+	Transports   []string
+	UserHandle   []byte
+	CreatedAt    time.Time
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+const apiTokenPrefix = "tlog_"
+
+// HandleGetAccountTokens renders the account settings page listing the
+// user's API tokens.
+func (s *Server) HandleGetAccountTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	user := ctx.User()
+	if user == nil {
+		http.Redirect(w, r, "/signin", http.StatusFound)
+		return
+	}
+
+	tokens, err := s.db.APITokensForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx.SetTitle("API tokens")
+	ctx.SetActiveTab("account")
+	ctx.SetData(tokens)
+	s.render(w, r, "account_tokens")
+}
+
+// HandlePostAccountToken issues a new API token and renders its
+// plaintext value once; only the hash is stored.
+func (s *Server) HandlePostAccountToken(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	user := ctx.User()
+	if user == nil {
+		http.Redirect(w, r, "/signin", http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		panic(err)
+	}
+
+	var scopes []string
+	if s := r.FormValue("scopes"); s != "" {
+		for _, scope := range strings.Split(s, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	plaintext, hash, err := generateAPIToken()
+	if err != nil {
+		panic(err)
+	}
+
+	token := &models.APIToken{
+		UserID:    user.ID,
+		Name:      r.FormValue("name"),
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.CreateAPIToken(token); err != nil {
+		panic(err)
+	}
+
+	ctx.SetTitle("API tokens")
+	ctx.SetActiveTab("account")
+	ctx.SetData(struct {
+		Token *models.APIToken
+		Value string
+	}{token, plaintext})
+	s.render(w, r, "account_token_created")
+}
+
+// HandleDeleteAccountToken revokes one of the user's tokens.
+func (s *Server) HandleDeleteAccountToken(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	user := ctx.User()
+	if user == nil {
+		http.Redirect(w, r, "/signin", http.StatusFound)
+		return
+	}
+
+	id, err := strconv.ParseInt(ctx.Params().ByName("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	tokens, err := s.db.APITokensForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+	owned := false
+	for _, t := range tokens {
+		if t.ID == id {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := s.db.RevokeAPIToken(id); err != nil {
+		panic(err)
+	}
+	http.Redirect(w, r, "/account/tokens", http.StatusFound)
+}
+
+// generateAPIToken returns a new random, prefixed plaintext token along
+// with the SHA-256 hash that should be persisted.
+func generateAPIToken() (plaintext string, hash []byte, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	plaintext = apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(plaintext))
+	return plaintext, sum[:], nil
+}
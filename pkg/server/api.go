@@ -0,0 +1,359 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// apiLog is the JSON representation of a models.Log returned by the v1
+// API. It deliberately omits Data - use the download endpoint for the
+// file itself.
+type apiLog struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Format     string    `json:"format"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func newAPILog(log *models.Log) apiLog {
+	return apiLog{ID: log.ID, Name: log.Name, Format: log.Format, UploadedAt: log.UploadedAt}
+}
+
+func (s *Server) apiUser(w http.ResponseWriter, r *http.Request) *models.User {
+	ctx := NewContext(r, w)
+	user := ctx.User()
+	if user == nil {
+		writeAPIError(w, http.StatusUnauthorized, "missing or invalid API token")
+	}
+	return user
+}
+
+// requireScope enforces that the token which authenticated this request
+// - if it was a bearer token at all, rather than e.g. a session cookie -
+// grants scope. An unscoped token, or a request authenticated some
+// other way, is treated as unrestricted, matching models.APIToken.HasScope.
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	ctx := NewContext(r, w)
+	token := ctx.APIToken()
+	if token == nil {
+		return true
+	}
+	if !token.HasScope(scope) {
+		writeAPIError(w, http.StatusForbidden, "token does not have the \""+scope+"\" scope")
+		return false
+	}
+	return true
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+func writeAPIJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// logIDParam reads the :id route param as an int64.
+func logIDParam(r *http.Request, w http.ResponseWriter) (int64, bool) {
+	ctx := NewContext(r, w)
+	id, err := strconv.ParseInt(ctx.Params().ByName("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "log not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleAPIGetLogs lists the authenticated user's logs.
+func (s *Server) HandleAPIGetLogs(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	if !requireScope(w, r, "logs:read") {
+		return
+	}
+
+	logs, err := s.db.LogsForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	out := make([]apiLog, len(logs))
+	for i, log := range logs {
+		out[i] = newAPILog(log)
+	}
+	writeAPIJSON(w, out)
+}
+
+// maxLogUploadSize caps the size of a single uploaded log file, whether
+// sent as a raw body or as one part of a multipart/form-data request.
+const maxLogUploadSize = 64 << 20
+
+// HandleAPIPostLog uploads one or more new logs, accepted either as
+// multipart/form-data (one or more "file" parts, for multi-file
+// uploads) or as a single raw body whose Content-Type identifies the
+// format (gpx, tcx or fit).
+func (s *Server) HandleAPIPostLog(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	if !requireScope(w, r, "logs:write") {
+		return
+	}
+
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mt == "multipart/form-data" {
+		s.handleAPIPostLogMultipart(w, r, user)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxLogUploadSize))
+	if err != nil {
+		panic(err)
+	}
+	format := logFormatFromContentType(r.Header.Get("Content-Type"))
+	if format == "" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "unrecognised log format")
+		return
+	}
+
+	log, err := s.createUploadedLog(user, "", format, data)
+	if err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	writeAPIJSON(w, newAPILog(log))
+}
+
+// handleAPIPostLogMultipart handles the multipart/form-data branch of
+// HandleAPIPostLog, creating one log per "file" part so a single
+// request can upload several files at once.
+func (s *Server) handleAPIPostLogMultipart(w http.ResponseWriter, r *http.Request, user *models.User) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLogUploadSize)
+	if err := r.ParseMultipartForm(maxLogUploadSize); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "request body too large or malformed multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "missing \"file\" form field")
+		return
+	}
+
+	logs := make([]apiLog, 0, len(headers))
+	for _, header := range headers {
+		format := logFormatFromContentType(header.Header.Get("Content-Type"))
+		if format == "" {
+			writeAPIError(w, http.StatusUnsupportedMediaType, "unrecognised log format for \""+header.Filename+"\"")
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			panic(err)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(file, maxLogUploadSize))
+		file.Close()
+		if err != nil {
+			panic(err)
+		}
+
+		log, err := s.createUploadedLog(user, header.Filename, format, data)
+		if err != nil {
+			panic(err)
+		}
+		logs = append(logs, newAPILog(log))
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	writeAPIJSON(w, logs)
+}
+
+// createUploadedLog stores a single uploaded log and bumps the user's
+// tracks_version so cached heatmap tiles are invalidated.
+func (s *Server) createUploadedLog(user *models.User, name, format string, data []byte) (*models.Log, error) {
+	log := &models.Log{
+		UserID:     user.ID,
+		Name:       name,
+		Format:     format,
+		Data:       data,
+		UploadedAt: time.Now(),
+	}
+	if err := s.db.CreateLog(log); err != nil {
+		return nil, err
+	}
+	if err := s.db.BumpTracksVersion(user.ID); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+func logFormatFromContentType(ct string) string {
+	switch ct {
+	case "application/gpx+xml":
+		return "gpx"
+	case "application/vnd.ant.fit", "application/octet-stream":
+		return "fit"
+	case "application/vnd.garmin.tcx+xml":
+		return "tcx"
+	default:
+		return ""
+	}
+}
+
+// HandleAPIGetLog returns metadata for a single log owned by the caller.
+func (s *Server) HandleAPIGetLog(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	if !requireScope(w, r, "logs:read") {
+		return
+	}
+	id, ok := logIDParam(r, w)
+	if !ok {
+		return
+	}
+
+	log, err := s.db.LogByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if log == nil || log.UserID != user.ID {
+		writeAPIError(w, http.StatusNotFound, "log not found")
+		return
+	}
+
+	writeAPIJSON(w, newAPILog(log))
+}
+
+// HandleAPIPatchLog updates a log's name.
+func (s *Server) HandleAPIPatchLog(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	if !requireScope(w, r, "logs:write") {
+		return
+	}
+	id, ok := logIDParam(r, w)
+	if !ok {
+		return
+	}
+
+	log, err := s.db.LogByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if log == nil || log.UserID != user.ID {
+		writeAPIError(w, http.StatusNotFound, "log not found")
+		return
+	}
+
+	var body struct {
+		Name *string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Name != nil {
+		log.Name = *body.Name
+	}
+
+	if err := s.db.UpdateLog(log); err != nil {
+		panic(err)
+	}
+	if err := s.db.BumpTracksVersion(user.ID); err != nil {
+		panic(err)
+	}
+	writeAPIJSON(w, newAPILog(log))
+}
+
+// HandleAPIDeleteLog deletes a log owned by the caller.
+func (s *Server) HandleAPIDeleteLog(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	if !requireScope(w, r, "logs:write") {
+		return
+	}
+	id, ok := logIDParam(r, w)
+	if !ok {
+		return
+	}
+
+	log, err := s.db.LogByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if log == nil || log.UserID != user.ID {
+		writeAPIError(w, http.StatusNotFound, "log not found")
+		return
+	}
+
+	if err := s.db.DeleteLog(id); err != nil {
+		panic(err)
+	}
+	if err := s.db.BumpTracksVersion(user.ID); err != nil {
+		panic(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAPIDownloadLog streams the log back in its original format, or
+// converted to the format named by the ?format= query param.
+func (s *Server) HandleAPIDownloadLog(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	if !requireScope(w, r, "logs:read") {
+		return
+	}
+	id, ok := logIDParam(r, w)
+	if !ok {
+		return
+	}
+
+	log, err := s.db.LogByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if log == nil || log.UserID != user.ID {
+		writeAPIError(w, http.StatusNotFound, "log not found")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" || format == log.Format {
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(log.Name))
+		w.Write(log.Data)
+		return
+	}
+
+	converted, contentType, err := convertLog(log, format)
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(converted)
+}
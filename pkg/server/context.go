@@ -0,0 +1,141 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	gcontext "github.com/gorilla/context"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+type contextKey int
+
+const (
+	startKey contextKey = iota
+	paramsKey
+	userKey
+	titleKey
+	activeTabKey
+	breadcrumbKey
+	dataKey
+	noLayoutKey
+	loggerKey
+	apiTokenKey
+)
+
+// Breadcrumb is a single entry in a page's breadcrumb trail.
+type Breadcrumb struct {
+	Label string
+	URL   string
+	Prev  *Breadcrumb
+}
+
+// Context carries per-request state - the authenticated user, routing
+// params, template data - between wrapHandler, the handler it dispatches
+// to, and render. It is backed by gorilla/context so handlers don't need
+// an extra parameter threaded through every signature.
+type Context struct {
+	r *http.Request
+}
+
+// NewContext returns the Context for r. w is currently unused but kept so
+// callers have a consistent construction point if Context ever needs to
+// write directly to the response.
+func NewContext(r *http.Request, w http.ResponseWriter) *Context {
+	return &Context{r: r}
+}
+
+func (c *Context) SetStart(t time.Time) { gcontext.Set(c.r, startKey, t) }
+
+func (c *Context) Start() time.Time {
+	if t, ok := gcontext.GetOk(c.r, startKey); ok {
+		return t.(time.Time)
+	}
+	return time.Time{}
+}
+
+func (c *Context) SetParams(ps httprouter.Params) { gcontext.Set(c.r, paramsKey, ps) }
+
+func (c *Context) Params() httprouter.Params {
+	if ps, ok := gcontext.GetOk(c.r, paramsKey); ok {
+		return ps.(httprouter.Params)
+	}
+	return nil
+}
+
+func (c *Context) SetUser(u *models.User) { gcontext.Set(c.r, userKey, u) }
+
+func (c *Context) User() *models.User {
+	if u, ok := gcontext.GetOk(c.r, userKey); ok {
+		return u.(*models.User)
+	}
+	return nil
+}
+
+func (c *Context) SetTitle(title string) { gcontext.Set(c.r, titleKey, title) }
+
+func (c *Context) Title() string {
+	if t, ok := gcontext.GetOk(c.r, titleKey); ok {
+		return t.(string)
+	}
+	return ""
+}
+
+func (c *Context) SetActiveTab(tab string) { gcontext.Set(c.r, activeTabKey, tab) }
+
+func (c *Context) ActiveTab() string {
+	if t, ok := gcontext.GetOk(c.r, activeTabKey); ok {
+		return t.(string)
+	}
+	return ""
+}
+
+func (c *Context) SetBreadcrumb(b *Breadcrumb) { gcontext.Set(c.r, breadcrumbKey, b) }
+
+func (c *Context) Breadcrumb() *Breadcrumb {
+	if b, ok := gcontext.GetOk(c.r, breadcrumbKey); ok {
+		return b.(*Breadcrumb)
+	}
+	return nil
+}
+
+func (c *Context) SetData(data interface{}) { gcontext.Set(c.r, dataKey, data) }
+
+func (c *Context) Data() interface{} {
+	v, _ := gcontext.GetOk(c.r, dataKey)
+	return v
+}
+
+func (c *Context) SetNoLayout(v bool) { gcontext.Set(c.r, noLayoutKey, v) }
+
+func (c *Context) NoLayout() bool {
+	v, ok := gcontext.GetOk(c.r, noLayoutKey)
+	return ok && v.(bool)
+}
+
+// SetAPIToken records the *models.APIToken that authenticated the
+// request, when it was a bearer token rather than a session cookie or
+// other mode. requireScope reads it back to enforce scopes.
+func (c *Context) SetAPIToken(t *models.APIToken) { gcontext.Set(c.r, apiTokenKey, t) }
+
+func (c *Context) APIToken() *models.APIToken {
+	if t, ok := gcontext.GetOk(c.r, apiTokenKey); ok {
+		return t.(*models.APIToken)
+	}
+	return nil
+}
+
+func (c *Context) SetLogger(logger *slog.Logger) { gcontext.Set(c.r, loggerKey, logger) }
+
+// Logger returns the request-scoped logger set by requestIDMiddleware,
+// or slog.Default() if called before that middleware has run (as it can
+// be from code under test that constructs a Context directly).
+func (c *Context) Logger() *slog.Logger {
+	if l, ok := gcontext.GetOk(c.r, loggerKey); ok {
+		return l.(*slog.Logger)
+	}
+	return slog.Default()
+}
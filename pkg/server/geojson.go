@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// geoJSONFeatureCollection and geoJSONFeature are a minimal subset of the
+// GeoJSON spec - just enough to describe a track as one LineString per
+// segment, with per-point properties MapLibre/Mapbox can style by.
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	Geometry   geoJSONLineString `json:"geometry"`
+	Properties geoJSONProperties `json:"properties"`
+}
+
+type geoJSONLineString struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"`
+}
+
+// geoJSONProperties carries one entry per coordinate, in the same order,
+// following the de facto convention used by leaflet-gpx and friends for
+// attaching per-vertex data to a LineString.
+type geoJSONProperties struct {
+	Time []string  `json:"time"`
+	Ele  []float64 `json:"ele"`
+	HR   []int     `json:"hr"`
+	Cad  []int     `json:"cad"`
+}
+
+func trackToGeoJSON(track *models.Track) geoJSONFeatureCollection {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection"}
+	for _, seg := range track.Segments {
+		feature := geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONLineString{Type: "LineString"},
+		}
+		for _, p := range seg.Points {
+			feature.Geometry.Coordinates = append(feature.Geometry.Coordinates, [2]float64{p.Lon, p.Lat})
+			feature.Properties.Time = append(feature.Properties.Time, p.Time.Format("2006-01-02T15:04:05Z07:00"))
+			feature.Properties.Ele = append(feature.Properties.Ele, p.Ele)
+			feature.Properties.HR = append(feature.Properties.HR, p.HR)
+			feature.Properties.Cad = append(feature.Properties.Cad, p.Cadence)
+		}
+		fc.Features = append(fc.Features, feature)
+	}
+	return fc
+}
+
+// logToGeoJSON parses log and renders it as a GeoJSON FeatureCollection.
+func logToGeoJSON(log *models.Log) ([]byte, error) {
+	track, err := models.ParseTrack(log)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(trackToGeoJSON(track))
+}
+
+// HandleGetLogGeoJSON serves a single log as a GeoJSON FeatureCollection
+// for map rendering.
+func (s *Server) HandleGetLogGeoJSON(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	id, ok := logIDParam(r, w)
+	if !ok {
+		return
+	}
+
+	log, err := s.db.LogByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if log == nil || log.UserID != user.ID {
+		writeAPIError(w, http.StatusNotFound, "log not found")
+		return
+	}
+
+	data, err := logToGeoJSON(log)
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Write(data)
+}
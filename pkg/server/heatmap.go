@@ -0,0 +1,340 @@
+package server
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// heatmapBlurRadiusForZoom scales the Gaussian blur radius (in pixels)
+// with zoom: zoomed-out tiles cover more ground per pixel, so points need
+// to bleed further to read as a continuous trail.
+func heatmapBlurRadiusForZoom(z int) int {
+	switch {
+	case z <= 8:
+		return 12
+	case z <= 12:
+		return 6
+	default:
+		return 3
+	}
+}
+
+// heatmapTilePath returns where a rendered tile for
+// (userID, z, x, y, tracksVersion) is cached on disk under DataDir.
+func heatmapTilePath(userID, z, x, y int, tracksVersion int64, ext string) string {
+	return filepath.Join(DataDir, "cache", "heatmap",
+		strconv.Itoa(userID), strconv.FormatInt(tracksVersion, 10),
+		strconv.Itoa(z), strconv.Itoa(x), fmt.Sprintf("%d.%s", y, ext))
+}
+
+func tileRouteParams(r *http.Request, w http.ResponseWriter) (z, x, y int, ok bool) {
+	ctx := NewContext(r, w)
+	var err error
+	if z, err = strconv.Atoi(ctx.Params().ByName("z")); err != nil {
+		return 0, 0, 0, false
+	}
+	if x, err = strconv.Atoi(ctx.Params().ByName("x")); err != nil {
+		return 0, 0, 0, false
+	}
+	yStr := ctx.Params().ByName("y")
+	yStr = yStr[:len(yStr)-len(filepath.Ext(yStr))]
+	if y, err = strconv.Atoi(yStr); err != nil {
+		return 0, 0, 0, false
+	}
+	return z, x, y, true
+}
+
+// HandleHeatmapTile serves a heatmap tile for all of the requesting
+// user's tracks, as a raster PNG or - if the request's :y.mvt extension
+// says so - a vector tile.
+func (s *Server) HandleHeatmapTile(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	if filepath.Ext(ctx.Params().ByName("y")) == ".mvt" {
+		s.handleHeatmapTileMVT(w, r)
+		return
+	}
+	s.handleHeatmapTilePNG(w, r)
+}
+
+// handleHeatmapTilePNG rasterises a heatmap tile, caching it on disk and
+// invalidating it whenever the user's tracks_version changes.
+func (s *Server) handleHeatmapTilePNG(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	z, x, y, ok := tileRouteParams(r, w)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	version, err := s.db.TracksVersion(user.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	path := heatmapTilePath(int(user.ID), z, x, y, version, "png")
+	if data, err := ioutil.ReadFile(path); err == nil {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+		return
+	}
+
+	minLon, minLat, maxLon, maxLat := tileBounds(z, x, y)
+	points, err := s.db.PointsForUserInBBox(user.ID, minLon, minLat, maxLon, maxLat)
+	if err != nil {
+		panic(err)
+	}
+
+	img := renderHeatmapTile(points, z, x, y)
+
+	if err := writeHeatmapTilePNG(path, img); err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, img)
+}
+
+// writeHeatmapTilePNG encodes img as a PNG to a temp file in the same
+// directory as path and renames it into place, so a concurrent request
+// for the same tile can never observe a partially-written file via
+// ioutil.ReadFile.
+func writeHeatmapTilePNG(path string, img image.Image) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".tmp-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// renderHeatmapTile accumulates points into a tileSize x tileSize
+// intensity buffer, blurs it, and maps the result through a colour ramp.
+func renderHeatmapTile(points []models.Point, z, x, y int) image.Image {
+	var intensity [tileSize][tileSize]float64
+
+	originX, originY := float64(x*tileSize), float64(y*tileSize)
+	for _, p := range points {
+		px, py := lonLatToPixel(p.Lon, p.Lat, z)
+		ix, iy := int(px-originX), int(py-originY)
+		if ix < 0 || ix >= tileSize || iy < 0 || iy >= tileSize {
+			continue
+		}
+		intensity[ix][iy]++
+	}
+
+	blurred := gaussianBlur(intensity, heatmapBlurRadiusForZoom(z))
+
+	img := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	maxV := 0.0
+	for i := range blurred {
+		for j := range blurred[i] {
+			if blurred[i][j] > maxV {
+				maxV = blurred[i][j]
+			}
+		}
+	}
+	for i := 0; i < tileSize; i++ {
+		for j := 0; j < tileSize; j++ {
+			img.Set(i, j, heatmapColor(blurred[i][j], maxV))
+		}
+	}
+	return img
+}
+
+// gaussianBlur applies a separable Gaussian blur of the given pixel
+// radius to buf, returning a new buffer.
+func gaussianBlur(buf [tileSize][tileSize]float64, radius int) [tileSize][tileSize]float64 {
+	if radius <= 0 {
+		return buf
+	}
+
+	kernel := gaussianKernel(radius)
+
+	var tmp, out [tileSize][tileSize]float64
+	for i := 0; i < tileSize; i++ {
+		for j := 0; j < tileSize; j++ {
+			var sum float64
+			for k := -radius; k <= radius; k++ {
+				if xi := i + k; xi >= 0 && xi < tileSize {
+					sum += buf[xi][j] * kernel[k+radius]
+				}
+			}
+			tmp[i][j] = sum
+		}
+	}
+	for i := 0; i < tileSize; i++ {
+		for j := 0; j < tileSize; j++ {
+			var sum float64
+			for k := -radius; k <= radius; k++ {
+				if yj := j + k; yj >= 0 && yj < tileSize {
+					sum += tmp[i][yj] * kernel[k+radius]
+				}
+			}
+			out[i][j] = sum
+		}
+	}
+	return out
+}
+
+func gaussianKernel(radius int) []float64 {
+	sigma := float64(radius) / 2
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		v := math.Exp(-(d * d) / (2 * sigma * sigma))
+		kernel[i] = v
+		sum += v
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// heatmapColor maps a normalised intensity value through a blue -> green
+// -> yellow -> red ramp, reminiscent of Strava's global heatmap.
+//
+// The stops are color.NRGBA (straight, unassociated alpha) rather than
+// color.RGBA: RGBA's R/G/B are alpha-premultiplied and must never
+// exceed A, which these ramp colours (e.g. full-intensity blue at low
+// alpha) don't satisfy. Returning NRGBA and letting image.RGBA.Set
+// convert it does the premultiplication correctly; constructing a
+// color.RGBA directly from these values would not.
+func heatmapColor(v, max float64) color.NRGBA {
+	if max == 0 || v == 0 {
+		return color.NRGBA{}
+	}
+	t := v / max
+	if t > 1 {
+		t = 1
+	}
+
+	stops := []color.NRGBA{
+		{0, 0, 255, 0},
+		{0, 255, 255, 160},
+		{0, 255, 0, 200},
+		{255, 255, 0, 220},
+		{255, 0, 0, 255},
+	}
+	scaled := t * float64(len(stops)-1)
+	i := int(scaled)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	frac := scaled - float64(i)
+	a, b := stops[i], stops[i+1]
+	lerp := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*frac) }
+	return color.NRGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), lerp(a.A, b.A)}
+}
+
+// handleHeatmapTileMVT serves the same tile as a Mapbox vector tile, with
+// one simplified LineString feature per track segment instead of a
+// raster - useful for client-side styling (e.g. highlighting a route on
+// hover).
+func (s *Server) handleHeatmapTileMVT(w http.ResponseWriter, r *http.Request) {
+	user := s.apiUser(w, r)
+	if user == nil {
+		return
+	}
+	z, x, y, ok := tileRouteParams(r, w)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	minLon, minLat, maxLon, maxLat := tileBounds(z, x, y)
+	points, err := s.db.PointsForUserInBBox(user.ID, minLon, minLat, maxLon, maxLat)
+	if err != nil {
+		panic(err)
+	}
+
+	tolerance := 4 / math.Pow(2, float64(z))
+	fc := geojson.NewFeatureCollection()
+	for _, segment := range groupPointsBySegment(points) {
+		line := make(orb.LineString, len(segment))
+		for i, p := range segment {
+			line[i] = orb.Point{p.Lon, p.Lat}
+		}
+		simplified := simplify.DouglasPeucker(tolerance).Simplify(line.Clone())
+		fc.Append(geojson.NewFeature(simplified))
+	}
+
+	layers := mvt.NewLayers(map[string]*geojson.FeatureCollection{"tracks": fc})
+	layers.ProjectToTile(maptile.New(uint32(x), uint32(y), maptile.Zoom(z)))
+
+	data, err := mvt.MarshalGzipped(layers)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Write(data)
+}
+
+// pointSegment identifies one (log, segment) pair within a set of
+// points returned by PointsForUserInBBox.
+type pointSegment struct {
+	LogID        int64
+	SegmentIndex int
+}
+
+// groupPointsBySegment regroups points - returned by PointsForUserInBBox
+// across many logs and segments, in no particular order - back into
+// one time-ordered slice per (LogID, SegmentIndex), so each can become
+// its own LineString instead of one zig-zag across every track in the
+// tile.
+func groupPointsBySegment(points []models.Point) [][]models.Point {
+	bySegment := make(map[pointSegment][]models.Point)
+	var order []pointSegment
+	for _, p := range points {
+		key := pointSegment{p.LogID, p.SegmentIndex}
+		if _, ok := bySegment[key]; !ok {
+			order = append(order, key)
+		}
+		bySegment[key] = append(bySegment[key], p)
+	}
+
+	segments := make([][]models.Point, len(order))
+	for i, key := range order {
+		segment := bySegment[key]
+		sort.Slice(segment, func(a, b int) bool { return segment[a].Time.Before(segment[b].Time) })
+		segments[i] = segment
+	}
+	return segments
+}
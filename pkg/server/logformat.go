@@ -0,0 +1,20 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// convertLog converts log's stored Data into the requested format,
+// returning the converted bytes and the Content-Type to serve them with.
+// Only a subset of conversions are supported; anything else is an error.
+func convertLog(log *models.Log, format string) ([]byte, string, error) {
+	switch format {
+	case "geojson":
+		data, err := logToGeoJSON(log)
+		return data, "application/geo+json", err
+	default:
+		return nil, "", fmt.Errorf("cannot convert a %s log to %s", log.Format, format)
+	}
+}
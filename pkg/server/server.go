@@ -9,14 +9,13 @@ import (
 	"path"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/codegangsta/negroni"
+	"github.com/duo-labs/webauthn/webauthn"
 	"github.com/gorilla/context"
 	"github.com/gorilla/csrf"
-	"github.com/gorilla/handlers"
 	"github.com/julienschmidt/httprouter"
 	"github.com/kaleworsley/tracklog"
+	"github.com/kaleworsley/tracklog/pkg/auth"
 	"github.com/kaleworsley/tracklog/pkg/config"
 	"github.com/kaleworsley/tracklog/pkg/db"
 	"github.com/kaleworsley/tracklog/pkg/models"
@@ -30,17 +29,23 @@ func init() {
 var DataDir = "."
 
 type Server struct {
-	config      *config.Config
-	db          db.DB
-	handler     http.Handler
-	csrfHandler func(http.Handler) http.Handler
-	tmpl        *template.Template
+	config *config.Config
+	db     db.DB
+
+	auth      auth.Chain
+	session   *auth.SessionAuth
+	oidc      *auth.OIDCAuth
+	apiTokens *auth.APITokenAuth
+	webauthn  *webauthn.WebAuthn
+
+	handler http.Handler
+	tmpl    *template.Template
 }
 
-func New(conf *config.Config, db db.DB) (*Server, error) {
+func New(conf *config.Config, d db.DB) (*Server, error) {
 	s := &Server{
 		config: conf,
-		db:     db,
+		db:     d,
 	}
 
 	if !s.config.Server.Development {
@@ -51,42 +56,109 @@ func New(conf *config.Config, db db.DB) (*Server, error) {
 		s.tmpl = tmpl
 	}
 
-	n := negroni.Classic()
+	if err := s.buildAuth(); err != nil {
+		return nil, err
+	}
 
-	csrfHandler := csrf.Protect(
-		[]byte(s.config.Server.CSRFAuthKey),
-		csrf.Secure(!s.config.Server.Development),
-		csrf.FieldName("_csrf"),
-	)
-	n.UseFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		csrfHandler(next).ServeHTTP(w, r)
-	})
+	wa, err := newWebAuthn(conf)
+	if err != nil {
+		return nil, err
+	}
+	s.webauthn = wa
 
-	n.UseFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		handlers.HTTPMethodOverrideHandler(next).ServeHTTP(w, r)
-	})
-	n.UseFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		handlers.CompressHandler(next).ServeHTTP(w, r)
-	})
+	s.handler = s.buildHandler(s.buildRouter())
+	return s, nil
+}
 
-	n.UseFunc(s.userAuthMiddleware)
+// buildAuth constructs s.session, s.oidc and the auth.Chain that
+// authMiddleware consults, in the order credentials should be
+// tried: a trusted reverse proxy's header takes precedence (it has
+// already authenticated the request), then the session cookie, then
+// OIDC, then an API bearer token.
+func (s *Server) buildAuth() error {
+	s.session = auth.NewSessionAuth(s.db, s.config.Server.SigningKey, !s.config.Server.Development)
 
+	oidcAuth, err := auth.NewOIDCAuth(s.db, s.config.Server.OIDC)
+	if err != nil {
+		return err
+	}
+	s.oidc = oidcAuth
+
+	var chain auth.Chain
+	if s.config.Server.ReverseProxyAuth {
+		chain = append(chain, &auth.ReverseProxyAuth{
+			DB:           s.db,
+			Header:       s.config.Server.ReverseProxyAuthHeader,
+			AutoRegister: s.config.Server.ReverseProxyAuthAutoRegister,
+		})
+	}
+	chain = append(chain, s.session)
+	if s.oidc != nil {
+		chain = append(chain, s.oidc)
+	}
+	s.apiTokens = &auth.APITokenAuth{DB: s.db}
+	chain = append(chain, s.apiTokens)
+	s.auth = chain
+
+	return nil
+}
+
+// buildRouter registers every route this server serves.
+func (s *Server) buildRouter() *httprouter.Router {
 	r := httprouter.New()
 	r.ServeFiles("/static/*filepath", http.Dir(path.Join(DataDir, "public")))
+
 	r.GET("/signin", s.wrapHandler(s.HandleGetSignIn))
 	r.POST("/signin", s.wrapHandler(s.HandlePostSignIn))
 	r.POST("/signout", s.wrapHandler(s.HandlePostSignOut))
+	if s.oidc != nil {
+		r.GET("/auth/oidc/login", s.wrapHandler(s.HandleOIDCLogin))
+		r.GET("/auth/oidc/callback", s.wrapHandler(s.HandleOIDCCallback))
+	}
+	r.POST("/account/webauthn/register/begin", s.wrapHandler(s.HandleWebAuthnRegisterBegin))
+	r.POST("/account/webauthn/register/finish", s.wrapHandler(s.HandleWebAuthnRegisterFinish))
+	r.POST("/signin/webauthn/begin", s.wrapHandler(s.HandleWebAuthnSignInBegin))
+	r.POST("/signin/webauthn/finish", s.wrapHandler(s.HandleWebAuthnSignInFinish))
+
 	r.GET("/logs", s.wrapHandler(s.HandleGetLogs))
 	r.POST("/logs", s.wrapHandler(s.HandlePostLog))
 	r.GET("/logs/:id/download", s.wrapHandler(s.HandleDownloadLog))
+	r.GET("/logs/:id/geojson", s.wrapHandler(s.HandleGetLogGeoJSON))
 	r.GET("/logs/:id", s.wrapHandler(s.HandleGetLog))
 	r.PATCH("/logs/:id", s.wrapHandler(s.HandlePatchLog))
 	r.DELETE("/logs/:id", s.wrapHandler(s.HandleDeleteLog))
 	r.GET("/", s.wrapHandler(s.HandleDashboard))
-	n.UseHandler(r)
 
-	s.handler = n
-	return s, nil
+	r.GET("/account/tokens", s.wrapHandler(s.HandleGetAccountTokens))
+	r.POST("/account/tokens", s.wrapHandler(s.HandlePostAccountToken))
+	r.DELETE("/account/tokens/:id", s.wrapHandler(s.HandleDeleteAccountToken))
+
+	r.GET("/api/v1/logs", s.wrapHandler(s.HandleAPIGetLogs))
+	r.POST("/api/v1/logs", s.wrapHandler(s.HandleAPIPostLog))
+	r.GET("/api/v1/logs/:id", s.wrapHandler(s.HandleAPIGetLog))
+	r.PATCH("/api/v1/logs/:id", s.wrapHandler(s.HandleAPIPatchLog))
+	r.DELETE("/api/v1/logs/:id", s.wrapHandler(s.HandleAPIDeleteLog))
+	r.GET("/api/v1/logs/:id/download", s.wrapHandler(s.HandleAPIDownloadLog))
+
+	r.GET("/tiles/heatmap/:z/:x/:y", s.wrapHandler(s.HandleHeatmapTile))
+
+	return r
+}
+
+// buildHandler composes the named middleware stack around router. Each
+// piece is independent so it can be tested (or reordered) on its own,
+// rather than being buried in a chain of inline negroni.UseFunc closures.
+func (s *Server) buildHandler(router http.Handler) http.Handler {
+	n := negroni.New()
+	n.UseFunc(requestIDMiddleware)
+	n.UseFunc(recoverMiddleware)
+	n.UseFunc(accessLogMiddleware)
+	n.UseFunc(s.csrfMiddleware)
+	n.UseFunc(methodOverrideMiddleware)
+	n.UseFunc(compressMiddleware)
+	n.UseFunc(s.authMiddleware)
+	n.UseHandler(router)
+	return n
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -105,49 +177,29 @@ func (s *Server) wrapHandler(handler HandlerFunc) httprouter.Handle {
 	}
 }
 
-func (s *Server) userAuthMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	if s.config.Server.ReverseProxyAuth {
-		username := r.Header.Get(s.config.Server.ReverseProxyAuthHeader)
-		if len(username) > 0 {
-			user, err := s.db.UserByUsername(username)
-			if user == nil && err == nil {
-				if s.config.Server.ReverseProxyAuthAutoRegister {
-					pwbytes := make([]byte, 128)
-					rand.Read(pwbytes)
-					pwhash, _ := bcrypt.GenerateFromPassword(pwbytes, bcrypt.DefaultCost)
-
-					user := &models.User{
-						Username: username,
-						Password: string(pwhash),
-					}
-
-					s.db.AddUser(user)
-
-					ctx := NewContext(r, w)
-					ctx.SetUser(user)
-
-					next(w, r)
-					return
-				}
-			}
-
-			if user != nil {
-				ctx := NewContext(r, w)
-				ctx.SetUser(user)
-
-				next(w, r)
-				return
-			}
-		}
-	}
-
-	user, err := s.userFromRequest(r)
+// authMiddleware is the thin loop promised by the auth package split:
+// it just asks s.auth, the configured Chain, who (if anyone) the
+// request is from. For API requests it additionally resolves the
+// bearer token itself (not just the user it belongs to), so handlers
+// can enforce its scopes via requireScope.
+func (s *Server) authMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	user, err := s.auth.Authenticate(r)
 	if err != nil {
 		panic(err)
 	}
 	if user != nil {
 		ctx := NewContext(r, w)
 		ctx.SetUser(user)
+
+		if isAPIRequest(r) {
+			apiToken, err := s.apiTokens.ResolveToken(r)
+			if err != nil {
+				panic(err)
+			}
+			if apiToken != nil {
+				ctx.SetAPIToken(apiToken)
+			}
+		}
 	}
 	next(w, r)
 }
@@ -164,6 +216,7 @@ type renderData struct {
 	CSRFToken         string
 	CSRFField         template.HTML
 	MapboxAccessToken string
+	OIDCEnabled       bool
 	Version           string
 	Runtime           string
 	Content           template.HTML
@@ -190,6 +243,7 @@ func (s *Server) render(w http.ResponseWriter, r *http.Request, name string) {
 		CSRFToken:         csrf.Token(r),
 		CSRFField:         csrf.TemplateField(r),
 		MapboxAccessToken: s.config.Server.MapboxAccessToken,
+		OIDCEnabled:       s.oidc != nil,
 		Version:           tracklog.Version,
 		Data:              ctx.Data(),
 	}
@@ -199,6 +253,7 @@ func (s *Server) render(w http.ResponseWriter, r *http.Request, name string) {
 
 	if ctx.NoLayout() {
 		if err := tmpl.ExecuteTemplate(w, name+".html", data); err != nil {
+			s.logRecover(r, err)
 			panic(err)
 		}
 		return
@@ -206,6 +261,7 @@ func (s *Server) render(w http.ResponseWriter, r *http.Request, name string) {
 
 	buf := new(bytes.Buffer)
 	if err := tmpl.ExecuteTemplate(buf, name+".html", data); err != nil {
+		s.logRecover(r, err)
 		panic(err)
 	}
 	data.Content = template.HTML(buf.String())
@@ -213,6 +269,7 @@ func (s *Server) render(w http.ResponseWriter, r *http.Request, name string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	if err := tmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		s.logRecover(r, err)
 		panic(err)
 	}
 }
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gcontext "github.com/gorilla/context"
+
+	"github.com/kaleworsley/tracklog/pkg/auth"
+	"github.com/kaleworsley/tracklog/pkg/db/dbtest"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+func TestAuthMiddlewareSetsUser(t *testing.T) {
+	d := dbtest.New()
+	user := &models.User{Username: "alice"}
+	if err := d.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	session := auth.NewSessionAuth(d, "test-signing-key", false)
+
+	s := &Server{db: d, auth: auth.Chain{session}, apiTokens: &auth.APITokenAuth{DB: d}}
+
+	rec := httptest.NewRecorder()
+	session.SetCookie(rec, user)
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	defer gcontext.Clear(req)
+
+	var gotUser *models.User
+	s.authMiddleware(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+		gotUser = NewContext(r, w).User()
+	})
+
+	if gotUser == nil || gotUser.Username != "alice" {
+		t.Errorf("expected authMiddleware to set the authenticated user on context; got %v", gotUser)
+	}
+}
+
+func TestAuthMiddlewareAnonymous(t *testing.T) {
+	d := dbtest.New()
+	s := &Server{db: d, auth: auth.Chain{auth.NewSessionAuth(d, "test-signing-key", false)}, apiTokens: &auth.APITokenAuth{DB: d}}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	defer gcontext.Clear(req)
+
+	called := false
+	s.authMiddleware(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if u := NewContext(r, w).User(); u != nil {
+			t.Errorf("expected no user on an anonymous request; got %v", u)
+		}
+	})
+	if !called {
+		t.Error("expected next to be called even with no authenticated user")
+	}
+}
+
+func TestAuthMiddlewareSetsAPITokenForAPIRequests(t *testing.T) {
+	d := dbtest.New()
+	user := &models.User{Username: "alice"}
+	if err := d.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("tlog_test"))
+	token := &models.APIToken{UserID: user.ID, Hash: hash[:], Scopes: []string{"logs:read"}}
+	if err := d.CreateAPIToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{db: d, auth: auth.Chain{&auth.APITokenAuth{DB: d}}, apiTokens: &auth.APITokenAuth{DB: d}}
+
+	req := httptest.NewRequest("GET", "/api/v1/logs", nil)
+	req.Header.Set("Authorization", "Bearer tlog_test")
+	defer gcontext.Clear(req)
+
+	var gotToken *models.APIToken
+	s.authMiddleware(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+		gotToken = NewContext(r, w).APIToken()
+	})
+
+	if gotToken == nil || !gotToken.HasScope("logs:read") {
+		t.Errorf("expected the resolved API token to be set on context; got %v", gotToken)
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+// setSessionCookie signs user in by writing a session cookie.
+// authMiddleware resolves it back to a *models.User on subsequent
+// requests via s.session.
+func (s *Server) setSessionCookie(w http.ResponseWriter, user *models.User) {
+	s.session.SetCookie(w, user)
+}
+
+// clearSessionCookie signs the current user out.
+func (s *Server) clearSessionCookie(w http.ResponseWriter) {
+	s.session.ClearCookie(w)
+}
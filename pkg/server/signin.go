@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// signInData is the template Data for signin.html. It's one named
+// struct, rather than a different anonymous struct per code path,
+// because the template has to be able to read any of these fields
+// regardless of which handler set them.
+type signInData struct {
+	Error           string
+	Username        string
+	RequireWebAuthn bool
+}
+
+// HandleGetSignIn renders the username/password sign-in form.
+func (s *Server) HandleGetSignIn(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	ctx.SetTitle("Sign in")
+	ctx.SetData(signInData{})
+	s.render(w, r, "signin")
+}
+
+// HandlePostSignIn verifies a username and password. If WebAuthn is
+// configured to be required for login and the user has registered
+// credentials, the session cookie is not set here - the form is
+// re-rendered so the browser can complete a passkey assertion via
+// /signin/webauthn/begin and /signin/webauthn/finish, which is what
+// actually calls setSessionCookie.
+func (s *Server) HandlePostSignIn(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		panic(err)
+	}
+	username := r.FormValue("username")
+
+	user, err := s.db.UserByUsername(username)
+	if err != nil {
+		panic(err)
+	}
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(r.FormValue("password"))) != nil {
+		s.renderSignInError(w, r, "invalid username or password")
+		return
+	}
+
+	if s.requireWebAuthnForLogin() {
+		creds, err := s.db.CredentialsForUser(user.ID)
+		if err != nil {
+			panic(err)
+		}
+		if len(creds) > 0 {
+			ctx := NewContext(r, w)
+			ctx.SetTitle("Sign in")
+			ctx.SetData(signInData{Username: username, RequireWebAuthn: true})
+			s.render(w, r, "signin")
+			return
+		}
+	}
+
+	s.setSessionCookie(w, user)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (s *Server) renderSignInError(w http.ResponseWriter, r *http.Request, message string) {
+	ctx := NewContext(r, w)
+	ctx.SetTitle("Sign in")
+	ctx.SetData(signInData{Error: message})
+	w.WriteHeader(http.StatusForbidden)
+	s.render(w, r, "signin")
+}
+
+// HandlePostSignOut clears the session cookie.
+func (s *Server) HandlePostSignOut(w http.ResponseWriter, r *http.Request) {
+	s.clearSessionCookie(w)
+	http.Redirect(w, r, "/signin", http.StatusFound)
+}
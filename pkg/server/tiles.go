@@ -0,0 +1,32 @@
+package server
+
+import "math"
+
+const tileSize = 256
+
+// lonLatToPixel projects (lon, lat) to absolute pixel coordinates in the
+// standard Web Mercator slippy-map scheme at zoom z.
+func lonLatToPixel(lon, lat float64, z int) (x, y float64) {
+	n := math.Exp2(float64(z)) * tileSize
+	x = (lon + 180) / 360 * n
+
+	latRad := lat * math.Pi / 180
+	y = (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+	return x, y
+}
+
+// tileBounds returns the (minLon, minLat, maxLon, maxLat) bounding box of
+// tile (z, x, y).
+func tileBounds(z, x, y int) (minLon, minLat, maxLon, maxLat float64) {
+	n := math.Exp2(float64(z))
+	minLon = float64(x)/n*360 - 180
+	maxLon = float64(x+1)/n*360 - 180
+	maxLat = tileLat(y, n)
+	minLat = tileLat(y+1, n)
+	return minLon, minLat, maxLon, maxLat
+}
+
+func tileLat(y int, n float64) float64 {
+	rad := math.Atan(math.Sinh(math.Pi * (1 - 2*float64(y)/n)))
+	return rad * 180 / math.Pi
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/duo-labs/webauthn/webauthn"
+	"github.com/gorilla/securecookie"
+
+	"github.com/kaleworsley/tracklog/pkg/config"
+	"github.com/kaleworsley/tracklog/pkg/models"
+)
+
+const webauthnSessionCookieName = "webauthn_session"
+
+// webauthnUser adapts a models.User and its registered credentials to
+// the interface the webauthn library expects.
+type webauthnUser struct {
+	user        *models.User
+	credentials []*models.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return []byte(u.user.Username) }
+func (u *webauthnUser) WebAuthnName() string        { return u.user.Username }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.user.Username }
+func (u *webauthnUser) WebAuthnIcon() string        { return "" }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		creds[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: "",
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return creds
+}
+
+// newWebAuthn builds a *webauthn.WebAuthn whose relying party ID is
+// derived from the configured listen address, e.g. ":8080" -> "localhost"
+// and "tracklog.example.com:443" -> "tracklog.example.com".
+func newWebAuthn(conf *config.Config) (*webauthn.WebAuthn, error) {
+	host := conf.Server.ListenAddress
+	port := ""
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		port = host[i:]
+		host = host[:i]
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	scheme := "https"
+	if conf.Server.Development {
+		scheme = "http"
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPDisplayName: "tracklog",
+		RPID:          host,
+		RPOrigin:      scheme + "://" + host + port,
+	})
+}
+
+// requireWebAuthnForLogin reports whether the password sign-in form must
+// additionally collect a passkey assertion before HandlePostSignIn calls
+// setSessionCookie.
+func (s *Server) requireWebAuthnForLogin() bool {
+	return s.config.Server.WebAuthn.RequireForLogin
+}
+
+func (s *Server) webauthnSessionCookies() *securecookie.SecureCookie {
+	return securecookie.New([]byte(s.config.Server.SigningKey), nil)
+}
+
+func (s *Server) putWebAuthnSession(w http.ResponseWriter, session *webauthn.SessionData) {
+	encoded, err := s.webauthnSessionCookies().Encode(webauthnSessionCookieName, session)
+	if err != nil {
+		panic(err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     webauthnSessionCookieName,
+		Value:    encoded,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   !s.config.Server.Development,
+	})
+}
+
+func (s *Server) takeWebAuthnSession(w http.ResponseWriter, r *http.Request) (*webauthn.SessionData, error) {
+	cookie, err := r.Cookie(webauthnSessionCookieName)
+	if err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, &http.Cookie{Name: webauthnSessionCookieName, Path: "/", MaxAge: -1})
+
+	var session webauthn.SessionData
+	if err := s.webauthnSessionCookies().Decode(webauthnSessionCookieName, cookie.Value, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// HandleWebAuthnRegisterBegin starts registration of a new credential for
+// the signed-in user.
+func (s *Server) HandleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	user := ctx.User()
+	if user == nil {
+		http.Error(w, "sign in required", http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.db.CredentialsForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	options, session, err := s.webauthn.BeginRegistration(&webauthnUser{user: user, credentials: creds})
+	if err != nil {
+		panic(err)
+	}
+
+	s.putWebAuthnSession(w, session)
+	json.NewEncoder(w).Encode(options)
+}
+
+// HandleWebAuthnRegisterFinish verifies the browser's attestation
+// response and stores the new credential.
+func (s *Server) HandleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	ctx := NewContext(r, w)
+	user := ctx.User()
+	if user == nil {
+		http.Error(w, "sign in required", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := s.takeWebAuthnSession(w, r)
+	if err != nil {
+		http.Error(w, "missing or expired registration session", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := s.db.CredentialsForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	cred, err := s.webauthn.FinishRegistration(&webauthnUser{user: user, credentials: creds}, *session, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := s.db.AddCredential(&models.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.Authenticator.SignCount,
+		AAGUID:       cred.Authenticator.AAGUID,
+		UserHandle:   []byte(user.Username),
+	}); err != nil {
+		panic(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webauthnBeginLoginRequest is the JSON body posted to
+// /signin/webauthn/begin, identifying which user's credentials to
+// challenge.
+type webauthnBeginLoginRequest struct {
+	Username string `json:"username"`
+}
+
+// HandleWebAuthnSignInBegin starts a passkey sign-in (or second-factor
+// challenge) for the named user.
+func (s *Server) HandleWebAuthnSignInBegin(w http.ResponseWriter, r *http.Request) {
+	var body webauthnBeginLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.UserByUsername(body.Username)
+	if err != nil {
+		panic(err)
+	}
+	if user == nil {
+		http.Error(w, "invalid username or no credentials registered", http.StatusForbidden)
+		return
+	}
+
+	creds, err := s.db.CredentialsForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+	if len(creds) == 0 {
+		http.Error(w, "invalid username or no credentials registered", http.StatusForbidden)
+		return
+	}
+
+	options, session, err := s.webauthn.BeginLogin(&webauthnUser{user: user, credentials: creds})
+	if err != nil {
+		panic(err)
+	}
+
+	s.putWebAuthnSession(w, session)
+	json.NewEncoder(w).Encode(options)
+}
+
+// HandleWebAuthnSignInFinish verifies the assertion, rejects sign-count
+// regressions, and signs the user in.
+func (s *Server) HandleWebAuthnSignInFinish(w http.ResponseWriter, r *http.Request) {
+	session, err := s.takeWebAuthnSession(w, r)
+	if err != nil {
+		http.Error(w, "missing or expired sign-in session", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.UserByUsername(string(session.UserID))
+	if err != nil {
+		panic(err)
+	}
+	if user == nil {
+		http.Error(w, "unknown user", http.StatusForbidden)
+		return
+	}
+
+	creds, err := s.db.CredentialsForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	cred, err := s.webauthn.FinishLogin(&webauthnUser{user: user, credentials: creds}, *session, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	// FinishLogin does not fail on a sign-count regression (a possibly
+	// cloned authenticator); it only sets CloneWarning, so reject here.
+	if cred.Authenticator.CloneWarning {
+		http.Error(w, "authenticator sign count went backwards", http.StatusForbidden)
+		return
+	}
+
+	if err := s.db.UpdateCredentialSignCount(cred.ID, cred.Authenticator.SignCount); err != nil {
+		panic(err)
+	}
+
+	s.setSessionCookie(w, user)
+	w.WriteHeader(http.StatusNoContent)
+}